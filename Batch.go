@@ -0,0 +1,121 @@
+package aerospike
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// defaultConcurrency caps how many goroutines SetMany/DeleteMany fan work
+// out to when Database.Concurrency hasn't been set.
+const defaultConcurrency = 32
+
+// defaultMaxCASRetries caps how many times Update retries a read-mutate-write
+// cycle when Database.MaxCASRetries hasn't been set.
+const defaultMaxCASRetries = 10
+
+// BatchError aggregates the errors a batch operation ran into, keyed by id,
+// so callers get partial-success semantics instead of an all-or-nothing
+// failure.
+type BatchError struct {
+	Errors map[string]error
+}
+
+func (e *BatchError) Error() string {
+	return fmt.Sprintf("%d of the batch's operations failed", len(e.Errors))
+}
+
+func (db *Database) concurrency() int {
+	if db.Concurrency <= 0 {
+		return defaultConcurrency
+	}
+
+	return db.Concurrency
+}
+
+// SetMany writes every object in objs to table under the corresponding id in
+// ids, fanning the writes out across up to Database.Concurrency goroutines.
+// The Aerospike client has no true batch-write RPC, so this is the
+// pipelining equivalent of GetMany's BatchGetObjects. Errors are aggregated
+// per id rather than aborting the whole batch.
+func (db *Database) SetMany(table string, ids []string, objs interface{}) error {
+	objsVal := reflect.ValueOf(objs)
+
+	if objsVal.Len() != len(ids) {
+		return errors.New("ids and objs must be the same length")
+	}
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	sem := make(chan struct{}, db.concurrency())
+	errs := make(map[string]error)
+
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(id string, obj interface{}) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			if err := db.Set(table, id, obj); err != nil {
+				mu.Lock()
+				errs[id] = err
+				mu.Unlock()
+			}
+		}(id, objsVal.Index(i).Interface())
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return &BatchError{Errors: errs}
+	}
+
+	return nil
+}
+
+// DeleteMany deletes every id in ids from table, fanning the deletes out
+// across up to Database.Concurrency goroutines, and reports whether each
+// one existed. Errors are aggregated per id rather than aborting the whole
+// batch.
+func (db *Database) DeleteMany(table string, ids []string) ([]bool, error) {
+	existed := make([]bool, len(ids))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+
+	sem := make(chan struct{}, db.concurrency())
+	errs := make(map[string]error)
+
+	for i, id := range ids {
+		wg.Add(1)
+		sem <- struct{}{}
+
+		go func(i int, id string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			ok, err := db.Delete(table, id)
+
+			if err != nil {
+				mu.Lock()
+				errs[id] = err
+				mu.Unlock()
+				return
+			}
+
+			existed[i] = ok
+		}(i, id)
+	}
+
+	wg.Wait()
+
+	if len(errs) > 0 {
+		return existed, &BatchError{Errors: errs}
+	}
+
+	return existed, nil
+}
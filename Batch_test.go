@@ -0,0 +1,110 @@
+package aerospike
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/frozenprojects/aerospike/storage/memory"
+)
+
+type widget struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+// failingStorage wraps memory.Storage and fails Set/Delete for any id
+// containing "bad", so SetMany/DeleteMany's per-key error aggregation can be
+// exercised without a live Aerospike node.
+type failingStorage struct {
+	*memory.Storage
+}
+
+func (f *failingStorage) Set(table, id string, obj interface{}) error {
+	if strings.Contains(id, "bad") {
+		return errors.New("simulated write failure")
+	}
+
+	return f.Storage.Set(table, id, obj)
+}
+
+func (f *failingStorage) Delete(table, id string) (bool, error) {
+	if strings.Contains(id, "bad") {
+		return false, errors.New("simulated delete failure")
+	}
+
+	return f.Storage.Delete(table, id)
+}
+
+func newTestDatabase() *Database {
+	backend := &failingStorage{Storage: memory.New()}
+	return NewDatabase(backend, []interface{}{&widget{}})
+}
+
+func TestSetManyAggregatesErrors(t *testing.T) {
+	db := newTestDatabase()
+
+	ids := []string{"w1", "bad1", "w2", "bad2"}
+	objs := []*widget{
+		{ID: "w1", Name: "one"},
+		{ID: "bad1"},
+		{ID: "w2", Name: "two"},
+		{ID: "bad2"},
+	}
+
+	err := db.SetMany("widget", ids, objs)
+	if err == nil {
+		t.Fatal("SetMany returned no error, want a *BatchError")
+	}
+
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("SetMany returned %T, want *BatchError", err)
+	}
+	if len(batchErr.Errors) != 2 {
+		t.Fatalf("BatchError has %d entries, want 2", len(batchErr.Errors))
+	}
+	if _, ok := batchErr.Errors["bad1"]; !ok {
+		t.Error("BatchError missing entry for bad1")
+	}
+	if _, ok := batchErr.Errors["bad2"]; !ok {
+		t.Error("BatchError missing entry for bad2")
+	}
+
+	obj, err := db.Get("widget", "w1")
+	if err != nil || obj.(*widget).Name != "one" {
+		t.Fatalf("successful id w1 was not written: %v, %v", obj, err)
+	}
+}
+
+func TestDeleteManyAggregatesErrors(t *testing.T) {
+	db := newTestDatabase()
+
+	// Seed directly through the embedded memory.Storage, bypassing
+	// failingStorage.Set, so "bad1" exists to be (failingly) deleted.
+	backend := db.storage.(*failingStorage)
+	for _, id := range []string{"w1", "bad1", "w2"} {
+		if err := backend.Storage.Set("widget", id, &widget{ID: id}); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+
+	existed, err := db.DeleteMany("widget", []string{"w1", "bad1", "w2", "missing"})
+	if err == nil {
+		t.Fatal("DeleteMany returned no error, want a *BatchError")
+	}
+
+	batchErr, ok := err.(*BatchError)
+	if !ok {
+		t.Fatalf("DeleteMany returned %T, want *BatchError", err)
+	}
+	if len(batchErr.Errors) != 1 {
+		t.Fatalf("BatchError has %d entries, want 1", len(batchErr.Errors))
+	}
+
+	want := []bool{true, false, true, false}
+	if !reflect.DeepEqual(existed, want) {
+		t.Fatalf("DeleteMany existed = %v, want %v", existed, want)
+	}
+}
@@ -1,237 +1,287 @@
+// Package aerospike provides a typed, table-oriented wrapper around a
+// pluggable storage.Storage back-end. Despite the package name, the
+// back-end is no longer necessarily Aerospike itself — see storage/aerospike,
+// storage/memory and storage/tiedot for the available implementations.
 package aerospike
 
 import (
 	"errors"
 	"reflect"
 
-	as "github.com/aerospike/aerospike-client-go"
+	"github.com/frozenprojects/aerospike/storage"
 )
 
-func init() {
-	// This will make Aerospike use json tags for the field names in the database.
-	as.SetAerospikeTag("json")
-}
-
-// Database represents the Aerospike database.
+// Database is a typed view over a storage back-end: it registers which Go
+// type each table holds, and forwards operations to the underlying
+// storage.Storage implementation.
 type Database struct {
-	namespace string
-	types     map[string]reflect.Type
-	Client    *as.Client
+	storage storage.Storage
+
+	// Concurrency caps how many goroutines SetMany/DeleteMany fan writes
+	// out to. Defaults to defaultConcurrency when left at zero.
+	Concurrency int
+
+	// MaxCASRetries caps how many times Update retries a read-mutate-write
+	// cycle after losing a generation race. Defaults to
+	// defaultMaxCASRetries when left at zero.
+	MaxCASRetries int
+
+	logger  Logger
+	metrics Metrics
 }
 
-// NewDatabase creates a new database client.
-func NewDatabase(host string, port int, namespace string, tables []interface{}) *Database {
-	// Convert example objects to their respective types
-	tableTypes := make(map[string]reflect.Type)
+// NewDatabase creates a new Database backed by the given storage, mirroring
+// how go-git wires a storage back-end into git.NewRepository(s). Each
+// example object's type is registered against the table it names. Pass
+// WithLogger/WithMetrics to observe the operations it performs.
+func NewDatabase(backend storage.Storage, tables []interface{}, opts ...Option) *Database {
 	for _, example := range tables {
 		typeInfo := reflect.TypeOf(example).Elem()
-		tableTypes[typeInfo.Name()] = typeInfo
+		backend.RegisterType(typeInfo.Name(), typeInfo)
 	}
 
-	// Client policy
-	clientPolicy := as.NewClientPolicy()
-	clientPolicy.ConnectionQueueSize = 1024
+	db := &Database{storage: backend, Concurrency: defaultConcurrency, MaxCASRetries: defaultMaxCASRetries}
 
-	// Create client
-	client, err := as.NewClientWithPolicy(clientPolicy, host, port)
-
-	if err != nil {
-		panic(err)
+	for _, opt := range opts {
+		opt(db)
 	}
 
-	// Make Set() calls delete old fields instead of only updating new ones
-	client.DefaultWritePolicy.RecordExistsAction = as.REPLACE
-
-	// This will make delete actually...delete things...you know.
-	// Otherwise they'll just reappear after a node restart.
-	// client.DefaultWritePolicy.DurableDelete = true
-
-	// Make scans faster
-	client.DefaultScanPolicy.Priority = as.HIGH
-	client.DefaultScanPolicy.ConcurrentNodes = true
-	client.DefaultScanPolicy.IncludeBinData = true
-
-	return &Database{
-		namespace: namespace,
-		types:     tableTypes,
-		Client:    client,
-	}
+	return db
 }
 
 // Get retrieves an object from the table.
 func (db *Database) Get(table string, id string) (interface{}, error) {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
-
-	if keyErr != nil {
-		return nil, keyErr
-	}
+	var result interface{}
 
-	t, exists := db.types[table]
+	err := db.observe("Get", table, func() (int, int, error) {
+		var err error
+		result, err = db.storage.Get(table, id)
 
-	if !exists {
-		return nil, errors.New("Data type has not been defined for table " + table)
-	}
+		size := 0
+		if db.observing() {
+			size = sizeOf(result)
+		}
 
-	obj := reflect.New(t).Interface()
-	err := db.Client.GetObject(nil, pk, obj)
+		return size, 0, err
+	})
 
-	return obj, err
+	return result, err
 }
 
 // Set sets an object's data for the given ID and erases old fields.
 func (db *Database) Set(table string, id string, obj interface{}) error {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
-
-	if keyErr != nil {
-		return keyErr
-	}
-
-	return db.Client.PutObject(nil, pk, obj)
+	return db.observe("Set", table, func() (int, int, error) {
+		size := 0
+		if db.observing() {
+			size = sizeOf(obj)
+		}
+
+		return size, 0, db.storage.Set(table, id, obj)
+	})
 }
 
 // Delete deletes an object from the database and returns if it existed.
 func (db *Database) Delete(table string, id string) (existed bool, err error) {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
+	err = db.observe("Delete", table, func() (int, int, error) {
+		var e error
+		existed, e = db.storage.Delete(table, id)
+		return 0, 0, e
+	})
 
-	if keyErr != nil {
-		return false, keyErr
-	}
-
-	return db.Client.Delete(nil, pk)
+	return existed, err
 }
 
 // Exists tells you if the given record exists.
 func (db *Database) Exists(table string, id string) (bool, error) {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
-
-	if keyErr != nil {
-		return false, keyErr
-	}
-
-	return db.Client.Exists(nil, pk)
+	return db.storage.Exists(table, id)
 }
 
 // Scan writes all objects from a given table to the channel.
 func (db *Database) Scan(table string, channel interface{}) error {
-	_, err := db.Client.ScanAllObjects(nil, channel, db.namespace, table)
-	return err
+	return db.observe("Scan", table, func() (int, int, error) {
+		return 0, 0, db.storage.Scan(table, channel)
+	})
 }
 
 // All returns a stream of all objects in the given table.
 func (db *Database) All(table string) (interface{}, error) {
-	channel := reflect.MakeChan(db.types[table], 0)
-	err := db.Scan(table, channel)
-	return channel, err
+	t := db.storage.Type(table)
+
+	if t == nil {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	channel := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t), 0)
+	err := db.Scan(table, channel.Interface())
+	return channel.Interface(), err
 }
 
-// GetObject retrieves data from the table and stores it in the provided object.
-func (db *Database) GetObject(table string, id string, obj interface{}) error {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
+// GetMany performs a Get request for every ID in the ID list and returns a slice of objects.
+func (db *Database) GetMany(table string, idList []string) (interface{}, error) {
+	var result interface{}
 
-	if keyErr != nil {
-		return keyErr
-	}
+	err := db.observe("GetMany", table, func() (int, int, error) {
+		var e error
+		result, e = db.storage.GetMany(table, idList)
+
+		size := 0
+		if db.observing() {
+			size = sizeOf(result)
+		}
+
+		return size, 0, e
+	})
 
-	return db.Client.GetObject(nil, pk, obj)
+	return result, err
 }
 
-// GetMap retrieves the data as a map[string]interface{}.
-func (db *Database) GetMap(table string, id string) (as.BinMap, error) {
-	pk, keyErr := as.NewKey(db.namespace, table, id)
+// DeleteTable deletes all content from the given table.
+func (db *Database) DeleteTable(table string) error {
+	return db.storage.DeleteTable(table)
+}
 
-	if keyErr != nil {
-		return nil, keyErr
-	}
+// Type returns the type of the table.
+func (db *Database) Type(table string) reflect.Type {
+	return db.storage.Type(table)
+}
 
-	rec, err := db.Client.Get(nil, pk)
+// Types returns the types of all tables as a map.
+func (db *Database) Types() map[string]reflect.Type {
+	return db.storage.Types()
+}
+
+// CreateIndex creates a secondary index on the given field of the table, if
+// the underlying storage back-end supports one (see storage.Indexer).
+func (db *Database) CreateIndex(table, bin string, indexType storage.IndexType) error {
+	indexer, ok := db.storage.(storage.Indexer)
 
-	if err != nil {
-		return nil, err
+	if !ok {
+		return errors.New("storage back-end does not support secondary indexes")
 	}
 
-	if rec == nil {
-		return nil, errors.New("Record not found")
+	return indexer.CreateIndex(table, bin, indexType)
+}
+
+// DropIndex removes the named secondary index from the table, if the
+// underlying storage back-end supports one.
+func (db *Database) DropIndex(table, indexName string) error {
+	indexer, ok := db.storage.(storage.Indexer)
+
+	if !ok {
+		return errors.New("storage back-end does not support secondary indexes")
 	}
 
-	return rec.Bins, nil
+	return indexer.DropIndex(table, indexName)
 }
 
-// GetMany performs a Get request for every ID in the ID list and returns a slice of objects.
-func (db *Database) GetMany(table string, idList []string) (interface{}, error) {
-	// Get data type for that table
-	t, exists := db.types[table]
+// Query runs a filtered query against table and returns the matching
+// objects, unmarshalled into the registered type for that table.
+func (db *Database) Query(table string, filter storage.Filter) (interface{}, error) {
+	return db.storage.Query(table, filter)
+}
+
+// QueryStream runs a filtered query and streams the matching objects to the
+// returned channel as the storage back-end decodes them, mirroring the
+// streaming style of Scan/All instead of buffering the whole result set.
+func (db *Database) QueryStream(table string, filter storage.Filter) (interface{}, error) {
+	t := db.storage.Type(table)
 
-	if !exists {
+	if t == nil {
 		return nil, errors.New("Data type has not been defined for table " + table)
 	}
 
-	// Number of keys
-	num := len(idList)
+	channel := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, t), 0)
+	err := db.storage.QueryStream(table, filter, channel.Interface())
 
-	// Create a slice of pointers
-	objType := reflect.SliceOf(t)
-	ptrType := reflect.SliceOf(reflect.PtrTo(t))
-	objects := reflect.MakeSlice(objType, num, num)
-	pointers := reflect.MakeSlice(ptrType, num, num)
+	return channel.Interface(), err
+}
+
+// RegisterUDF registers the UDF module at path with the storage back-end, if
+// it supports server-side functions (see storage.UDFRunner).
+func (db *Database) RegisterUDF(path string) error {
+	runner, ok := db.storage.(storage.UDFRunner)
 
-	// Return early if there's nothing to do
-	if num == 0 {
-		return pointers.Interface(), nil
+	if !ok {
+		return errors.New("storage back-end does not support user-defined functions")
 	}
 
-	keys := make([]*as.Key, num, num)
-	interfaceSlice := make([]interface{}, num, num)
+	return runner.RegisterUDF(path)
+}
 
-	for i := 0; i < num; i++ {
-		keys[i], _ = as.NewKey(db.namespace, table, idList[i])
+// RemoveUDF removes the named UDF module from the storage back-end, if it
+// supports server-side functions.
+func (db *Database) RemoveUDF(name string) error {
+	runner, ok := db.storage.(storage.UDFRunner)
 
-		objAddr := objects.Index(i).Addr()
-		pointers.Index(i).Set(objAddr)
-		interfaceSlice[i] = objAddr.Interface()
+	if !ok {
+		return errors.New("storage back-end does not support user-defined functions")
 	}
 
-	// This needs an interface slice of pointers to structs.
-	_, err := db.Client.BatchGetObjects(nil, keys, interfaceSlice)
+	return runner.RemoveUDF(name)
+}
 
-	if err != nil {
-		return nil, err
+// Aggregate runs a server-side UDF aggregation over table, optionally
+// narrowed by filter, if the storage back-end supports one. Results are
+// decoded into the table's registered type when possible, or left as a raw
+// bin map otherwise.
+func (db *Database) Aggregate(table, udfPackage, udfFunc string, filter storage.Filter, args ...interface{}) (<-chan interface{}, error) {
+	runner, ok := db.storage.(storage.UDFRunner)
+
+	if !ok {
+		return nil, errors.New("storage back-end does not support user-defined functions")
 	}
 
-	return pointers.Interface(), nil
+	return runner.Aggregate(table, udfPackage, udfFunc, filter, args...)
 }
 
-// DeleteTable deletes all content from the given table.
-func (db *Database) DeleteTable(table string) error {
-	return db.Client.Truncate(nil, db.namespace, table, nil)
-}
+// AppendToList appends value to the CDT list stored in bin, if the storage
+// back-end supports CDT operations (see storage.CDTStore).
+func (db *Database) AppendToList(table, id, bin string, value interface{}) error {
+	store, ok := db.storage.(storage.CDTStore)
 
-// Namespace returns the name of the namespace.
-func (db *Database) Namespace() string {
-	return db.namespace
-}
+	if !ok {
+		return errors.New("storage back-end does not support CDT operations")
+	}
 
-// Type returns the type of the table.
-func (db *Database) Type(table string) reflect.Type {
-	return db.types[table]
+	return store.AppendToList(table, id, bin, value)
 }
 
-// Types returns the types of all tables as a map.
-func (db *Database) Types() map[string]reflect.Type {
-	return db.types
+// MapPut sets key to value in the CDT map stored in bin, if the storage
+// back-end supports CDT operations.
+func (db *Database) MapPut(table, id, bin, key string, value interface{}) error {
+	store, ok := db.storage.(storage.CDTStore)
+
+	if !ok {
+		return errors.New("storage back-end does not support CDT operations")
+	}
+
+	return store.MapPut(table, id, bin, key, value)
 }
 
-// // ForEach ...
-// func ForEach(set string, callback func(as.BinMap)) {
-// 	recs, _ := client.ScanAll(scanPolicy, namespace, set)
+// Update performs a generation-checked read-modify-write: it reads the
+// record, applies mutate to the decoded object, and writes it back only if
+// nobody else changed the record in the meantime, retrying up to
+// Database.MaxCASRetries times on a conflict. This is the safe alternative
+// to Set, which unconditionally replaces. The retries this took are
+// reported to the configured Logger/Metrics, as Get/Set/Delete/Scan/GetMany
+// report theirs.
+func (db *Database) Update(table, id string, mutate func(obj interface{}) error) error {
+	store, ok := db.storage.(storage.CDTStore)
+
+	if !ok {
+		return errors.New("storage back-end does not support CAS updates")
+	}
 
-// 	for res := range recs.Results() {
-// 		if res.Err != nil {
-// 			recs.Close()
-// 			return
-// 		}
+	return db.observe("Update", table, func() (int, int, error) {
+		retries, err := store.CASUpdate(table, id, mutate, db.maxCASRetries())
+		return 0, retries, err
+	})
+}
 
-// 		callback(res.Record.Bins)
-// 	}
+func (db *Database) maxCASRetries() int {
+	if db.MaxCASRetries <= 0 {
+		return defaultMaxCASRetries
+	}
 
-// 	recs.Close()
-// }
+	return db.MaxCASRetries
+}
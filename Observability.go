@@ -0,0 +1,94 @@
+package aerospike
+
+import (
+	"encoding/json"
+	"reflect"
+	"time"
+)
+
+// Logger receives a structured event for each Get, Set, Delete, Scan, GetMany
+// and Update call on Database (SetMany/DeleteMany report one event per id
+// through Set/Delete). Other Database methods are not logged. Adapters live
+// under observability/ (see observability/slog).
+type Logger interface {
+	LogOperation(op, table string, duration time.Duration, retries int, recordSize int, err error)
+}
+
+// Metrics receives per-operation measurements for dashboards and alerting,
+// for the same Database operations Logger covers. Adapters live under
+// observability/ (see observability/prometheus).
+type Metrics interface {
+	ObserveLatency(op, table string, duration time.Duration)
+	ObserveRecordSize(op, table string, bytes int)
+	ObserveRetry(op, table string, retries int)
+	ObserveError(op, table string, errClass string)
+}
+
+// Option configures optional Database behavior, such as observability hooks.
+type Option func(*Database)
+
+// WithLogger attaches a Logger that records the operations Logger lists.
+func WithLogger(logger Logger) Option {
+	return func(db *Database) { db.logger = logger }
+}
+
+// WithMetrics attaches a Metrics sink that records the operations Logger lists.
+func WithMetrics(metrics Metrics) Option {
+	return func(db *Database) { db.metrics = metrics }
+}
+
+// observing reports whether a Logger or Metrics sink is attached. Call
+// sites use it to skip computing recordSize (sizeOf marshals the record to
+// JSON) when nothing is listening for it.
+func (db *Database) observing() bool {
+	return db.logger != nil || db.metrics != nil
+}
+
+// observe times fn, then reports the op's duration, retry count, record
+// size and outcome to the configured Logger and Metrics, if any.
+func (db *Database) observe(op, table string, fn func() (recordSize int, retries int, err error)) error {
+	start := time.Now()
+	recordSize, retries, err := fn()
+	duration := time.Since(start)
+
+	if db.logger != nil {
+		db.logger.LogOperation(op, table, duration, retries, recordSize, err)
+	}
+
+	if db.metrics != nil {
+		db.metrics.ObserveLatency(op, table, duration)
+		db.metrics.ObserveRecordSize(op, table, recordSize)
+
+		if retries > 0 {
+			db.metrics.ObserveRetry(op, table, retries)
+		}
+
+		if err != nil {
+			db.metrics.ObserveError(op, table, errClass(err))
+		}
+	}
+
+	return err
+}
+
+// errClass reduces an error to a stable, low-cardinality label suitable for
+// a metrics dimension.
+func errClass(err error) string {
+	return reflect.TypeOf(err).String()
+}
+
+// sizeOf best-effort measures the serialized size of a record for metrics
+// purposes; it returns 0 rather than failing the operation it's measuring.
+func sizeOf(obj interface{}) int {
+	if obj == nil {
+		return 0
+	}
+
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		return 0
+	}
+
+	return len(data)
+}
@@ -0,0 +1,74 @@
+// Package prometheus adapts aerospike.Metrics onto Prometheus counters and
+// histograms.
+package prometheus
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/frozenprojects/aerospike"
+)
+
+// Metrics records Database operations as Prometheus collectors, labeled by
+// operation and table.
+type Metrics struct {
+	latency    *prometheus.HistogramVec
+	recordSize *prometheus.HistogramVec
+	retries    *prometheus.CounterVec
+	errors     *prometheus.CounterVec
+}
+
+var _ aerospike.Metrics = (*Metrics)(nil)
+
+// New creates the Prometheus collectors, registers them with reg, and
+// returns a Metrics ready to pass to aerospike.WithMetrics.
+func New(reg prometheus.Registerer) (*Metrics, error) {
+	m := &Metrics{
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name: "aerospike_database_operation_duration_seconds",
+			Help: "Duration of Database operations.",
+		}, []string{"op", "table"}),
+		recordSize: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "aerospike_database_record_size_bytes",
+			Help:    "Size of records read or written by Database operations.",
+			Buckets: prometheus.ExponentialBuckets(64, 4, 8),
+		}, []string{"op", "table"}),
+		retries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aerospike_database_operation_retries_total",
+			Help: "Retries performed by Database operations.",
+		}, []string{"op", "table"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "aerospike_database_operation_errors_total",
+			Help: "Errors returned by Database operations, labeled by error type.",
+		}, []string{"op", "table", "class"}),
+	}
+
+	for _, c := range []prometheus.Collector{m.latency, m.recordSize, m.retries, m.errors} {
+		if err := reg.Register(c); err != nil {
+			return nil, err
+		}
+	}
+
+	return m, nil
+}
+
+// ObserveLatency implements aerospike.Metrics.
+func (m *Metrics) ObserveLatency(op, table string, duration time.Duration) {
+	m.latency.WithLabelValues(op, table).Observe(duration.Seconds())
+}
+
+// ObserveRecordSize implements aerospike.Metrics.
+func (m *Metrics) ObserveRecordSize(op, table string, bytes int) {
+	m.recordSize.WithLabelValues(op, table).Observe(float64(bytes))
+}
+
+// ObserveRetry implements aerospike.Metrics.
+func (m *Metrics) ObserveRetry(op, table string, retries int) {
+	m.retries.WithLabelValues(op, table).Add(float64(retries))
+}
+
+// ObserveError implements aerospike.Metrics.
+func (m *Metrics) ObserveError(op, table string, errClass string) {
+	m.errors.WithLabelValues(op, table, errClass).Inc()
+}
@@ -0,0 +1,40 @@
+// Package slog adapts aerospike.Logger onto the standard library's
+// structured logger.
+package slog
+
+import (
+	"log/slog"
+	"time"
+
+	"github.com/frozenprojects/aerospike"
+)
+
+// Logger adapts a *slog.Logger into an aerospike.Logger.
+type Logger struct {
+	log *slog.Logger
+}
+
+var _ aerospike.Logger = (*Logger)(nil)
+
+// New wraps log as an aerospike.Logger suitable for aerospike.WithLogger.
+func New(log *slog.Logger) *Logger {
+	return &Logger{log: log}
+}
+
+// LogOperation implements aerospike.Logger.
+func (l *Logger) LogOperation(op, table string, duration time.Duration, retries int, recordSize int, err error) {
+	attrs := []any{
+		slog.String("op", op),
+		slog.String("table", table),
+		slog.Duration("duration", duration),
+		slog.Int("retries", retries),
+		slog.Int("record_size", recordSize),
+	}
+
+	if err != nil {
+		l.log.Error("database operation failed", append(attrs, slog.String("error", err.Error()))...)
+		return
+	}
+
+	l.log.Debug("database operation", attrs...)
+}
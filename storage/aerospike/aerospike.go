@@ -0,0 +1,540 @@
+// Package aerospike is the Aerospike-backed storage.Storage implementation.
+// It is the original, full-featured back-end: the others under storage/
+// trade off features for being runnable without a live Aerospike node.
+package aerospike
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+
+	as "github.com/aerospike/aerospike-client-go"
+	astypes "github.com/aerospike/aerospike-client-go/types"
+
+	"github.com/frozenprojects/aerospike/storage"
+)
+
+func init() {
+	// This will make Aerospike use json tags for the field names in the database.
+	as.SetAerospikeTag("json")
+}
+
+// Storage is the Aerospike implementation of storage.Storage.
+type Storage struct {
+	namespace string
+	types     map[string]reflect.Type
+	Client    *as.Client
+}
+
+// New creates a new Aerospike-backed storage.
+func New(host string, port int, namespace string) *Storage {
+	// Client policy
+	clientPolicy := as.NewClientPolicy()
+	clientPolicy.ConnectionQueueSize = 1024
+
+	// Create client
+	client, err := as.NewClientWithPolicy(clientPolicy, host, port)
+
+	if err != nil {
+		panic(err)
+	}
+
+	// Make Set() calls delete old fields instead of only updating new ones
+	client.DefaultWritePolicy.RecordExistsAction = as.REPLACE
+
+	// This will make delete actually...delete things...you know.
+	// Otherwise they'll just reappear after a node restart.
+	// client.DefaultWritePolicy.DurableDelete = true
+
+	// Make scans faster
+	client.DefaultScanPolicy.Priority = as.HIGH
+	client.DefaultScanPolicy.ConcurrentNodes = true
+	client.DefaultScanPolicy.IncludeBinData = true
+
+	return &Storage{
+		namespace: namespace,
+		types:     make(map[string]reflect.Type),
+		Client:    client,
+	}
+}
+
+// RegisterType associates a table name with the Go type stored in it.
+func (s *Storage) RegisterType(table string, t reflect.Type) {
+	s.types[table] = t
+}
+
+// Get retrieves an object from the table.
+func (s *Storage) Get(table string, id string) (interface{}, error) {
+	pk, keyErr := as.NewKey(s.namespace, table, id)
+
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	obj := reflect.New(t).Interface()
+	err := s.Client.GetObject(nil, pk, obj)
+
+	return obj, err
+}
+
+// Set sets an object's data for the given ID and erases old fields.
+func (s *Storage) Set(table string, id string, obj interface{}) error {
+	pk, keyErr := as.NewKey(s.namespace, table, id)
+
+	if keyErr != nil {
+		return keyErr
+	}
+
+	return s.Client.PutObject(nil, pk, obj)
+}
+
+// Delete deletes an object from the database and returns if it existed.
+func (s *Storage) Delete(table string, id string) (existed bool, err error) {
+	pk, keyErr := as.NewKey(s.namespace, table, id)
+
+	if keyErr != nil {
+		return false, keyErr
+	}
+
+	return s.Client.Delete(nil, pk)
+}
+
+// Exists tells you if the given record exists.
+func (s *Storage) Exists(table string, id string) (bool, error) {
+	pk, keyErr := as.NewKey(s.namespace, table, id)
+
+	if keyErr != nil {
+		return false, keyErr
+	}
+
+	return s.Client.Exists(nil, pk)
+}
+
+// Scan writes all objects from a given table to the channel.
+func (s *Storage) Scan(table string, channel interface{}) error {
+	_, err := s.Client.ScanAllObjects(nil, channel, s.namespace, table)
+	return err
+}
+
+// GetMap retrieves the data as a map[string]interface{}.
+func (s *Storage) GetMap(table string, id string) (as.BinMap, error) {
+	pk, keyErr := as.NewKey(s.namespace, table, id)
+
+	if keyErr != nil {
+		return nil, keyErr
+	}
+
+	rec, err := s.Client.Get(nil, pk)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if rec == nil {
+		return nil, errors.New("Record not found")
+	}
+
+	return rec.Bins, nil
+}
+
+// GetMany performs a Get request for every ID in the ID list and returns a slice of objects.
+func (s *Storage) GetMany(table string, idList []string) (interface{}, error) {
+	// Get data type for that table
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	// Number of keys
+	num := len(idList)
+
+	// Create a slice of pointers
+	objType := reflect.SliceOf(t)
+	ptrType := reflect.SliceOf(reflect.PtrTo(t))
+	objects := reflect.MakeSlice(objType, num, num)
+	pointers := reflect.MakeSlice(ptrType, num, num)
+
+	// Return early if there's nothing to do
+	if num == 0 {
+		return pointers.Interface(), nil
+	}
+
+	keys := make([]*as.Key, num, num)
+	interfaceSlice := make([]interface{}, num, num)
+
+	for i := 0; i < num; i++ {
+		keys[i], _ = as.NewKey(s.namespace, table, idList[i])
+
+		objAddr := objects.Index(i).Addr()
+		pointers.Index(i).Set(objAddr)
+		interfaceSlice[i] = objAddr.Interface()
+	}
+
+	// This needs an interface slice of pointers to structs.
+	_, err := s.Client.BatchGetObjects(nil, keys, interfaceSlice)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return pointers.Interface(), nil
+}
+
+// DeleteTable deletes all content from the given table.
+func (s *Storage) DeleteTable(table string) error {
+	return s.Client.Truncate(nil, s.namespace, table, nil)
+}
+
+// Namespace returns the name of the namespace.
+func (s *Storage) Namespace() string {
+	return s.namespace
+}
+
+// Type returns the type of the table.
+func (s *Storage) Type(table string) reflect.Type {
+	return s.types[table]
+}
+
+// Types returns the types of all tables as a map.
+func (s *Storage) Types() map[string]reflect.Type {
+	return s.types
+}
+
+func asIndexType(indexType storage.IndexType) as.IndexType {
+	if indexType == storage.IndexTypeString {
+		return as.STRING
+	}
+
+	return as.NUMERIC
+}
+
+func asFilter(filter storage.Filter) *as.Filter {
+	if filter.Range {
+		return as.NewRangeFilter(filter.Bin, filter.Begin, filter.End)
+	}
+
+	return as.NewEqualFilter(filter.Bin, filter.Value)
+}
+
+// CreateIndex creates a secondary index on the given bin of the table and
+// waits for it to come online.
+func (s *Storage) CreateIndex(table, bin string, indexType storage.IndexType) error {
+	indexName := table + "_" + bin + "_idx"
+
+	task, err := s.Client.CreateIndex(nil, s.namespace, table, indexName, bin, asIndexType(indexType))
+
+	if err != nil {
+		return err
+	}
+
+	return <-task.OnComplete()
+}
+
+// DropIndex removes the named secondary index from the table.
+func (s *Storage) DropIndex(table, indexName string) error {
+	return s.Client.DropIndex(nil, s.namespace, table, indexName)
+}
+
+// Query runs a secondary-index query against table and returns a slice of
+// the matching objects, unmarshalled into the registered type for that
+// table.
+func (s *Storage) Query(table string, filter storage.Filter) (interface{}, error) {
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	recordset, err := s.runQuery(table, filter)
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(t)), 0, 0)
+
+	for res := range recordset.Results() {
+		if res.Err != nil {
+			return nil, res.Err
+		}
+
+		obj := reflect.New(t)
+
+		if err := decodeBins(res.Record.Bins, obj.Interface()); err != nil {
+			return nil, err
+		}
+
+		results = reflect.Append(results, obj)
+	}
+
+	return results.Interface(), nil
+}
+
+// QueryStream runs a secondary-index query against table and writes each
+// matching object to channel as it arrives off the recordset, rather than
+// buffering the whole result set the way Query does.
+func (s *Storage) QueryStream(table string, filter storage.Filter, channel interface{}) error {
+	t, exists := s.types[table]
+
+	if !exists {
+		return errors.New("Data type has not been defined for table " + table)
+	}
+
+	recordset, err := s.runQuery(table, filter)
+
+	if err != nil {
+		return err
+	}
+
+	ch := reflect.ValueOf(channel)
+
+	go func() {
+		defer ch.Close()
+
+		for res := range recordset.Results() {
+			if res.Err != nil {
+				continue
+			}
+
+			obj := reflect.New(t)
+
+			if err := decodeBins(res.Record.Bins, obj.Interface()); err != nil {
+				continue
+			}
+
+			ch.Send(obj.Elem())
+		}
+	}()
+
+	return nil
+}
+
+func (s *Storage) runQuery(table string, filter storage.Filter) (*as.Recordset, error) {
+	statement := as.NewStatement(s.namespace, table)
+	statement.SetFilter(asFilter(filter))
+
+	return s.Client.Query(nil, statement)
+}
+
+// decodeBins maps a BinMap onto obj using the same json tags Aerospike was
+// configured to key off of (see the SetAerospikeTag call in this file's init).
+func decodeBins(bins as.BinMap, obj interface{}) error {
+	data, err := json.Marshal(bins)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, obj)
+}
+
+// RegisterUDF reads the Lua UDF module at path and registers it with the
+// Aerospike server under its own base filename.
+func (s *Storage) RegisterUDF(path string) error {
+	data, err := ioutil.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	task, err := s.Client.RegisterUDF(nil, data, filepath.Base(path), as.LUA)
+
+	if err != nil {
+		return err
+	}
+
+	return <-task.OnComplete()
+}
+
+// RemoveUDF removes the named UDF module from the server.
+func (s *Storage) RemoveUDF(name string) error {
+	task, err := s.Client.RemoveUDF(nil, name)
+
+	if err != nil {
+		return err
+	}
+
+	return <-task.OnComplete()
+}
+
+// Aggregate runs a server-side UDF aggregation over table, optionally
+// narrowed by filter, and streams each result to the returned channel,
+// decoded into the table's registered type when possible, or as a raw
+// map[string]interface{} otherwise.
+func (s *Storage) Aggregate(table, udfPackage, udfFunc string, filter storage.Filter, args ...interface{}) (<-chan interface{}, error) {
+	statement := as.NewStatement(s.namespace, table)
+
+	if filter.Bin != "" {
+		statement.SetFilter(asFilter(filter))
+	}
+
+	values := make([]as.Value, len(args))
+	for i, arg := range args {
+		values[i] = as.NewValue(arg)
+	}
+
+	recordset, err := s.Client.QueryAggregate(nil, statement, udfPackage, udfFunc, values...)
+
+	if err != nil {
+		return nil, err
+	}
+
+	t := s.types[table]
+	out := make(chan interface{})
+
+	go func() {
+		defer close(out)
+
+		for res := range recordset.Results() {
+			if res.Err != nil {
+				continue
+			}
+
+			bins, ok := normalizeSuccess(res.Record.Bins["SUCCESS"])
+
+			if !ok {
+				out <- res.Record.Bins
+				continue
+			}
+
+			if t == nil {
+				out <- bins
+				continue
+			}
+
+			obj := reflect.New(t)
+			data, err := json.Marshal(bins)
+
+			if err != nil || json.Unmarshal(data, obj.Interface()) != nil {
+				out <- bins
+				continue
+			}
+
+			out <- obj.Interface()
+		}
+	}()
+
+	return out, nil
+}
+
+// normalizeSuccess coerces a Lua aggregation's SUCCESS value into a
+// map[string]interface{} we can JSON round-trip into the registered type.
+// Map-returning Lua aggregations come back from the client as
+// map[interface{}]interface{}, not the as.BinMap (map[string]interface{})
+// a plain record read gives us.
+func normalizeSuccess(value interface{}) (map[string]interface{}, bool) {
+	switch v := value.(type) {
+	case as.BinMap:
+		return v, true
+	case map[string]interface{}:
+		return v, true
+	case map[interface{}]interface{}:
+		normalized := make(map[string]interface{}, len(v))
+
+		for key, val := range v {
+			k, ok := key.(string)
+
+			if !ok {
+				return nil, false
+			}
+
+			normalized[k] = val
+		}
+
+		return normalized, true
+	default:
+		return nil, false
+	}
+}
+
+// AppendToList appends value to the CDT list stored in bin, without
+// reading the record back through the type-mapping Get/Set path.
+func (s *Storage) AppendToList(table, id, bin string, value interface{}) error {
+	pk, err := as.NewKey(s.namespace, table, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.Operate(nil, pk, as.ListAppendOp(bin, value))
+	return err
+}
+
+// MapPut sets key to value in the CDT map stored in bin.
+func (s *Storage) MapPut(table, id, bin, key string, value interface{}) error {
+	pk, err := as.NewKey(s.namespace, table, id)
+
+	if err != nil {
+		return err
+	}
+
+	_, err = s.Client.Operate(nil, pk, as.MapPutOp(as.DefaultMapPolicy(), bin, key, value))
+	return err
+}
+
+// CASUpdate reads the record's generation with GetHeader, applies mutate to
+// the decoded object, and writes it back with GenerationPolicy set to
+// EXPECT_GEN_EQUAL, retrying the whole read-mutate-write cycle up to
+// maxRetries times if another writer wins the race. It reports how many
+// retries that took, for callers that want to observe it.
+func (s *Storage) CASUpdate(table, id string, mutate func(obj interface{}) error, maxRetries int) (int, error) {
+	t, exists := s.types[table]
+
+	if !exists {
+		return 0, errors.New("Data type has not been defined for table " + table)
+	}
+
+	pk, err := as.NewKey(s.namespace, table, id)
+
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		header, err := s.Client.GetHeader(nil, pk)
+
+		if err != nil {
+			return attempt, err
+		}
+
+		obj := reflect.New(t).Interface()
+
+		if err := s.Client.GetObject(nil, pk, obj); err != nil {
+			return attempt, err
+		}
+
+		if err := mutate(obj); err != nil {
+			return attempt, err
+		}
+
+		writePolicy := as.NewWritePolicy(header.Generation, 0)
+		writePolicy.GenerationPolicy = as.EXPECT_GEN_EQUAL
+		writePolicy.RecordExistsAction = as.REPLACE
+
+		err = s.Client.PutObject(writePolicy, pk, obj)
+
+		if err == nil {
+			return attempt, nil
+		}
+
+		if attempt >= maxRetries || !isGenerationError(err) {
+			return attempt, err
+		}
+	}
+}
+
+// isGenerationError reports whether err is Aerospike's way of telling us a
+// GenerationPolicy check failed, i.e. someone else wrote the record first.
+func isGenerationError(err error) bool {
+	aeroErr, ok := err.(astypes.AerospikeError)
+	return ok && aeroErr.ResultCode() == astypes.GENERATION_ERROR
+}
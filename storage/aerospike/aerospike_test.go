@@ -0,0 +1,59 @@
+package aerospike
+
+import "testing"
+
+func TestNormalizeSuccess(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  map[string]interface{}
+		ok    bool
+	}{
+		{
+			name:  "lua map result",
+			value: map[interface{}]interface{}{"total": 42},
+			want:  map[string]interface{}{"total": 42},
+			ok:    true,
+		},
+		{
+			name:  "plain string-keyed map",
+			value: map[string]interface{}{"total": 42},
+			want:  map[string]interface{}{"total": 42},
+			ok:    true,
+		},
+		{
+			name:  "non-string lua key",
+			value: map[interface{}]interface{}{42: "total"},
+			ok:    false,
+		},
+		{
+			name:  "scalar result",
+			value: int64(42),
+			ok:    false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := normalizeSuccess(tt.value)
+
+			if ok != tt.ok {
+				t.Fatalf("normalizeSuccess(%v) ok = %v, want %v", tt.value, ok, tt.ok)
+			}
+
+			if !ok {
+				return
+			}
+
+			if len(got) != len(tt.want) {
+				t.Fatalf("normalizeSuccess(%v) = %v, want %v", tt.value, got, tt.want)
+			}
+
+			for k, v := range tt.want {
+				if got[k] != v {
+					t.Fatalf("normalizeSuccess(%v)[%q] = %v, want %v", tt.value, k, got[k], v)
+				}
+			}
+		})
+	}
+}
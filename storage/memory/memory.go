@@ -0,0 +1,305 @@
+// Package memory is an in-memory storage.Storage implementation, useful for
+// unit tests and small single-process deployments that don't need
+// durability.
+package memory
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"sync"
+
+	"github.com/frozenprojects/aerospike/storage"
+)
+
+// Storage keeps every table as a map of id to object, guarded by a single
+// mutex. It answers Query by scanning, since it has no secondary indexes.
+type Storage struct {
+	mu     sync.RWMutex
+	types  map[string]reflect.Type
+	tables map[string]map[string]interface{}
+}
+
+// New creates a new, empty in-memory storage.
+func New() *Storage {
+	return &Storage{
+		types:  make(map[string]reflect.Type),
+		tables: make(map[string]map[string]interface{}),
+	}
+}
+
+// RegisterType associates a table name with the Go type stored in it.
+func (s *Storage) RegisterType(table string, t reflect.Type) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.types[table] = t
+	if _, exists := s.tables[table]; !exists {
+		s.tables[table] = make(map[string]interface{})
+	}
+}
+
+// Get retrieves an object from the table.
+func (s *Storage) Get(table string, id string) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	obj, exists := s.tables[table][id]
+
+	if !exists {
+		return nil, errors.New("Record not found")
+	}
+
+	return copyObject(s.types[table], obj)
+}
+
+// Set sets an object's data for the given ID, replacing anything stored there.
+func (s *Storage) Set(table string, id string, obj interface{}) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, exists := s.tables[table]; !exists {
+		s.tables[table] = make(map[string]interface{})
+	}
+
+	// Store a copy, not the caller's pointer, so mutating obj after Set
+	// doesn't reach back into the table the way it couldn't on the
+	// Aerospike/tiedot back-ends, which both serialize on write.
+	if t, exists := s.types[table]; exists {
+		objCopy, err := copyObject(t, obj)
+
+		if err != nil {
+			return err
+		}
+
+		obj = objCopy
+	}
+
+	s.tables[table][id] = obj
+	return nil
+}
+
+// Delete deletes an object from the table and returns if it existed.
+func (s *Storage) Delete(table string, id string) (existed bool, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	_, existed = s.tables[table][id]
+	delete(s.tables[table], id)
+	return existed, nil
+}
+
+// Exists tells you if the given record exists.
+func (s *Storage) Exists(table string, id string) (bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	_, exists := s.tables[table][id]
+	return exists, nil
+}
+
+// Scan writes all objects from a given table to the channel.
+func (s *Storage) Scan(table string, channel interface{}) error {
+	ch := reflect.ValueOf(channel)
+
+	s.mu.RLock()
+	objs := make([]interface{}, 0, len(s.tables[table]))
+	for _, obj := range s.tables[table] {
+		objs = append(objs, obj)
+	}
+	s.mu.RUnlock()
+
+	go func() {
+		for _, obj := range objs {
+			ch.Send(reflect.ValueOf(obj).Elem())
+		}
+		ch.Close()
+	}()
+
+	return nil
+}
+
+// GetMany performs a Get request for every ID in the ID list and returns a slice of objects.
+func (s *Storage) GetMany(table string, idList []string) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	ptrType := reflect.SliceOf(reflect.PtrTo(t))
+	pointers := reflect.MakeSlice(ptrType, 0, len(idList))
+
+	for _, id := range idList {
+		obj, exists := s.tables[table][id]
+
+		if !exists {
+			// Mirrors the Aerospike back-end, whose BatchGetObjects leaves a
+			// missing key's destination object zero-valued rather than nil.
+			pointers = reflect.Append(pointers, reflect.New(t))
+			continue
+		}
+
+		objCopy, err := copyObject(t, obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		pointers = reflect.Append(pointers, reflect.ValueOf(objCopy))
+	}
+
+	return pointers.Interface(), nil
+}
+
+// DeleteTable deletes all content from the given table.
+func (s *Storage) DeleteTable(table string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.tables[table] = make(map[string]interface{})
+	return nil
+}
+
+// Query answers a Filter by scanning the table, since the in-memory store
+// has no secondary indexes to consult.
+func (s *Storage) Query(table string, filter storage.Filter) (interface{}, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	ptrType := reflect.SliceOf(reflect.PtrTo(t))
+	results := reflect.MakeSlice(ptrType, 0, 0)
+
+	for _, obj := range s.tables[table] {
+		match, err := matchesFilter(obj, filter)
+
+		if err != nil {
+			return nil, err
+		}
+
+		if !match {
+			continue
+		}
+
+		objCopy, err := copyObject(t, obj)
+
+		if err != nil {
+			return nil, err
+		}
+
+		results = reflect.Append(results, reflect.ValueOf(objCopy))
+	}
+
+	return results.Interface(), nil
+}
+
+// QueryStream answers a Filter by running Query, then writes the matches to
+// channel from a goroutine instead of returning them as a slice. Unlike the
+// other back-ends, it collects the whole result set before sending any.
+func (s *Storage) QueryStream(table string, filter storage.Filter, channel interface{}) error {
+	results, err := s.Query(table, filter)
+
+	if err != nil {
+		return err
+	}
+
+	resultsVal := reflect.ValueOf(results)
+	ch := reflect.ValueOf(channel)
+
+	go func() {
+		defer ch.Close()
+
+		for i := 0; i < resultsVal.Len(); i++ {
+			ch.Send(resultsVal.Index(i).Elem())
+		}
+	}()
+
+	return nil
+}
+
+// copyObject returns a fresh *t decoded from obj's JSON representation, so
+// callers can't reach back into the table's backing storage and mutate it
+// through the value they were handed (the Aerospike/tiedot back-ends never
+// hand out their own internal copies either).
+func copyObject(t reflect.Type, obj interface{}) (interface{}, error) {
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	objCopy := reflect.New(t)
+
+	if err := json.Unmarshal(data, objCopy.Interface()); err != nil {
+		return nil, err
+	}
+
+	return objCopy.Interface(), nil
+}
+
+// matchesFilter checks a stored object against a Filter by round-tripping it
+// through JSON, so the field name lines up with the same json tags the
+// Aerospike back-end keys off of.
+func matchesFilter(obj interface{}, filter storage.Filter) (bool, error) {
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		return false, err
+	}
+
+	fields := make(map[string]interface{})
+
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return false, err
+	}
+
+	value, exists := fields[filter.Bin]
+
+	if !exists {
+		return false, nil
+	}
+
+	if filter.Range {
+		num, ok := value.(float64)
+		return ok && num >= float64(filter.Begin) && num <= float64(filter.End), nil
+	}
+
+	switch want := filter.Value.(type) {
+	case string:
+		got, ok := value.(string)
+		return ok && got == want, nil
+	case int:
+		got, ok := value.(float64)
+		return ok && got == float64(want), nil
+	case int64:
+		got, ok := value.(float64)
+		return ok && got == float64(want), nil
+	default:
+		return reflect.DeepEqual(value, filter.Value), nil
+	}
+}
+
+// Type returns the type of the table.
+func (s *Storage) Type(table string) reflect.Type {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.types[table]
+}
+
+// Types returns the types of all tables as a map.
+func (s *Storage) Types() map[string]reflect.Type {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.types
+}
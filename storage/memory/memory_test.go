@@ -0,0 +1,142 @@
+package memory
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/frozenprojects/aerospike/storage"
+)
+
+type widget struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+func newStorage() *Storage {
+	s := New()
+	s.RegisterType("widget", reflect.TypeOf(widget{}))
+	return s
+}
+
+func TestGetSetDeleteRoundTrip(t *testing.T) {
+	s := newStorage()
+
+	if err := s.Set("widget", "w1", &widget{ID: "w1", Name: "sprocket", Price: 100}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+
+	exists, err := s.Exists("widget", "w1")
+	if err != nil || !exists {
+		t.Fatalf("Exists = %v, %v; want true, nil", exists, err)
+	}
+
+	got, err := s.Get("widget", "w1")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+
+	w, ok := got.(*widget)
+	if !ok {
+		t.Fatalf("Get returned %T, want *widget", got)
+	}
+	if w.Name != "sprocket" || w.Price != 100 {
+		t.Fatalf("Get = %+v, want Name=sprocket Price=100", w)
+	}
+
+	// Mutating the object returned by Get must not affect what's stored.
+	w.Name = "mutated"
+	reGot, err := s.Get("widget", "w1")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if reGot.(*widget).Name != "sprocket" {
+		t.Fatalf("Get leaked a mutable reference to internal storage")
+	}
+
+	existed, err := s.Delete("widget", "w1")
+	if err != nil || !existed {
+		t.Fatalf("Delete = %v, %v; want true, nil", existed, err)
+	}
+
+	if _, err := s.Get("widget", "w1"); err == nil {
+		t.Fatal("Get after Delete returned no error")
+	}
+}
+
+func TestSetDoesNotAliasCallersPointer(t *testing.T) {
+	s := newStorage()
+
+	w := &widget{ID: "w1", Name: "sprocket", Price: 100}
+	if err := s.Set("widget", "w1", w); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+
+	// Mutating the object after Set must not affect what's stored.
+	w.Name = "mutated"
+
+	got, err := s.Get("widget", "w1")
+	if err != nil {
+		t.Fatalf("Get returned error: %v", err)
+	}
+	if got.(*widget).Name != "sprocket" {
+		t.Fatalf("Set aliased the caller's pointer into storage")
+	}
+}
+
+func TestGetManyWithMissingIDs(t *testing.T) {
+	s := newStorage()
+
+	if err := s.Set("widget", "w1", &widget{ID: "w1", Name: "sprocket"}); err != nil {
+		t.Fatalf("Set returned error: %v", err)
+	}
+
+	results, err := s.GetMany("widget", []string{"w1", "missing"})
+	if err != nil {
+		t.Fatalf("GetMany returned error: %v", err)
+	}
+
+	widgets, ok := results.([]*widget)
+	if !ok {
+		t.Fatalf("GetMany returned %T, want []*widget", results)
+	}
+	if len(widgets) != 2 {
+		t.Fatalf("GetMany returned %d results, want 2", len(widgets))
+	}
+	if widgets[0] == nil || widgets[0].Name != "sprocket" {
+		t.Fatalf("GetMany[0] = %+v, want sprocket", widgets[0])
+	}
+	if widgets[1] == nil || *widgets[1] != (widget{}) {
+		t.Fatalf("GetMany[1] = %+v, want a zero-valued widget for a missing id", widgets[1])
+	}
+}
+
+func TestQueryEqualityAndRange(t *testing.T) {
+	s := newStorage()
+
+	for _, w := range []*widget{
+		{ID: "w1", Name: "sprocket", Price: 100},
+		{ID: "w2", Name: "cog", Price: 250},
+		{ID: "w3", Name: "sprocket", Price: 400},
+	} {
+		if err := s.Set("widget", w.ID, w); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+
+	eqResults, err := s.Query("widget", storage.NewEqualFilter("name", "sprocket"))
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if got := len(eqResults.([]*widget)); got != 2 {
+		t.Fatalf("equality Query returned %d results, want 2", got)
+	}
+
+	rangeResults, err := s.Query("widget", storage.NewRangeFilter("price", 200, 400))
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+	if got := len(rangeResults.([]*widget)); got != 2 {
+		t.Fatalf("range Query returned %d results, want 2", got)
+	}
+}
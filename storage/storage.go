@@ -0,0 +1,96 @@
+// Package storage defines the persistence contract that Database delegates
+// to, so that the Aerospike client, an in-memory map, and other document
+// stores can all sit behind the same API.
+package storage
+
+import "reflect"
+
+// Storage is a pluggable persistence back-end. Database wraps a Storage and
+// adds table-type bookkeeping on top of it.
+type Storage interface {
+	Get(table, id string) (interface{}, error)
+	Set(table, id string, obj interface{}) error
+	Delete(table, id string) (existed bool, err error)
+	Exists(table, id string) (bool, error)
+	Scan(table string, channel interface{}) error
+
+	// GetMany returns one pointer per id in idList, in order. A missing id
+	// gets a pointer to a zero-valued record rather than a nil pointer, so
+	// callers can range and dereference without a nil check.
+	GetMany(table string, idList []string) (interface{}, error)
+	DeleteTable(table string) error
+	Query(table string, filter Filter) (interface{}, error)
+
+	// QueryStream is Query's streaming counterpart, mirroring Scan: it
+	// writes matching objects to channel as they're found instead of
+	// buffering the whole result set.
+	QueryStream(table string, filter Filter, channel interface{}) error
+
+	// RegisterType associates a table name with the Go type stored in it, so
+	// the back-end knows what to unmarshal records into.
+	RegisterType(table string, t reflect.Type)
+	Type(table string) reflect.Type
+	Types() map[string]reflect.Type
+}
+
+// Filter describes an equality or range condition on a single field, for use
+// with Storage.Query.
+type Filter struct {
+	Bin   string
+	Value interface{} // used for equality filters
+	Begin int64       // used for range filters
+	End   int64
+	Range bool
+}
+
+// NewEqualFilter builds a Filter that matches records where field == value.
+func NewEqualFilter(bin string, value interface{}) Filter {
+	return Filter{Bin: bin, Value: value}
+}
+
+// NewRangeFilter builds a Filter that matches records where
+// begin <= field <= end.
+func NewRangeFilter(bin string, begin, end int64) Filter {
+	return Filter{Bin: bin, Begin: begin, End: end, Range: true}
+}
+
+// IndexType identifies the kind of secondary index to create for a field.
+type IndexType int
+
+const (
+	// IndexTypeNumeric indexes a numeric field.
+	IndexTypeNumeric IndexType = iota
+	// IndexTypeString indexes a string field.
+	IndexTypeString
+)
+
+// Indexer is implemented by back-ends that support secondary indexes.
+// Back-ends that answer queries by scanning (e.g. the in-memory store) don't
+// need one, so it's kept separate from the core Storage interface.
+type Indexer interface {
+	CreateIndex(table, bin string, indexType IndexType) error
+	DropIndex(table, indexName string) error
+}
+
+// UDFRunner is implemented by back-ends that support server-side
+// user-defined functions and aggregation, such as Aerospike's Lua UDFs.
+// Back-ends without server-side execution (the in-memory store, tiedot)
+// don't implement it.
+type UDFRunner interface {
+	RegisterUDF(path string) error
+	RemoveUDF(name string) error
+	Aggregate(table, udfPackage, udfFunc string, filter Filter, args ...interface{}) (<-chan interface{}, error)
+}
+
+// CDTStore is implemented by back-ends that support Aerospike-style CDT
+// (list/map) bin operations and generation-based compare-and-swap updates.
+type CDTStore interface {
+	AppendToList(table, id, bin string, value interface{}) error
+	MapPut(table, id, bin, key string, value interface{}) error
+
+	// CASUpdate reads the record, applies mutate to it, and writes it back
+	// only if the record's generation hasn't changed since the read,
+	// retrying up to maxRetries times on a generation conflict. It returns
+	// how many retries that actually took, so callers can report it.
+	CASUpdate(table, id string, mutate func(obj interface{}) error, maxRetries int) (retries int, err error)
+}
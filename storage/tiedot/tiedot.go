@@ -0,0 +1,401 @@
+// Package tiedot is a storage.Storage implementation backed by tiedot
+// (https://github.com/HouzuoGuo/tiedot), an embedded document database. It
+// suits single-node deployments that want durability without running a
+// separate Aerospike cluster.
+package tiedot
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+
+	"github.com/HouzuoGuo/tiedot/db"
+
+	"github.com/frozenprojects/aerospike/storage"
+)
+
+// idField is the document field we index to emulate our string-keyed
+// tables; tiedot otherwise only knows its own internal integer document IDs.
+const idField = "_id"
+
+// Storage is a tiedot-backed storage.Storage implementation.
+type Storage struct {
+	db    *db.DB
+	types map[string]reflect.Type
+}
+
+// New opens (creating if necessary) a tiedot database rooted at dir.
+func New(dir string) (*Storage, error) {
+	tiedotDB, err := db.OpenDB(dir)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Storage{db: tiedotDB, types: make(map[string]reflect.Type)}, nil
+}
+
+// RegisterType associates a table name with the Go type stored in it, and
+// makes sure the backing collection and its ID index exist.
+func (s *Storage) RegisterType(table string, t reflect.Type) {
+	s.types[table] = t
+
+	if s.db.Use(table) == nil {
+		if err := s.db.Create(table); err != nil {
+			return
+		}
+	}
+
+	s.ensureIDIndex(table)
+}
+
+// ensureIDIndex (re)creates the idField index RegisterType installs.
+// DeleteTable needs to call this again after dropping and recreating the
+// collection, since a fresh collection starts with no indexes at all.
+func (s *Storage) ensureIDIndex(table string) {
+	s.db.Use(table).Index([]string{idField})
+}
+
+func (s *Storage) col(table string) (*db.Col, error) {
+	col := s.db.Use(table)
+
+	if col == nil {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	return col, nil
+}
+
+// lookup finds the tiedot document ID and contents for our external string
+// id, using the idField index registered in RegisterType.
+func (s *Storage) lookup(col *db.Col, id string) (docID int, doc map[string]interface{}, err error) {
+	query := map[string]interface{}{"eq": id, "in": []interface{}{idField}}
+
+	matched := make(map[int]struct{})
+
+	if err := db.EvalQuery(query, col, &matched); err != nil {
+		return 0, nil, err
+	}
+
+	for candidate := range matched {
+		found, err := col.Read(candidate)
+
+		if err != nil {
+			continue
+		}
+
+		return candidate, found, nil
+	}
+
+	return 0, nil, nil
+}
+
+// Get retrieves an object from the table.
+func (s *Storage) Get(table string, id string) (interface{}, error) {
+	col, err := s.col(table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, doc, err := s.lookup(col, id)
+
+	if err != nil {
+		return nil, err
+	}
+
+	if doc == nil {
+		return nil, errors.New("Record not found")
+	}
+
+	obj := reflect.New(s.types[table]).Interface()
+
+	return obj, decodeDoc(doc, obj)
+}
+
+// Set sets an object's data for the given ID, replacing anything stored there.
+func (s *Storage) Set(table string, id string, obj interface{}) error {
+	col, err := s.col(table)
+
+	if err != nil {
+		return err
+	}
+
+	doc, err := encodeDoc(obj)
+
+	if err != nil {
+		return err
+	}
+
+	doc[idField] = id
+
+	docID, existing, err := s.lookup(col, id)
+
+	if err != nil {
+		return err
+	}
+
+	if existing != nil {
+		return col.Update(docID, doc)
+	}
+
+	_, err = col.Insert(doc)
+	return err
+}
+
+// Delete deletes an object from the table and returns if it existed.
+func (s *Storage) Delete(table string, id string) (existed bool, err error) {
+	col, err := s.col(table)
+
+	if err != nil {
+		return false, err
+	}
+
+	docID, doc, err := s.lookup(col, id)
+
+	if err != nil {
+		return false, err
+	}
+
+	if doc == nil {
+		return false, nil
+	}
+
+	return true, col.Delete(docID)
+}
+
+// Exists tells you if the given record exists.
+func (s *Storage) Exists(table string, id string) (bool, error) {
+	col, err := s.col(table)
+
+	if err != nil {
+		return false, err
+	}
+
+	_, doc, err := s.lookup(col, id)
+
+	return doc != nil, err
+}
+
+// Scan writes all objects from a given table to the channel.
+func (s *Storage) Scan(table string, channel interface{}) error {
+	col, err := s.col(table)
+
+	if err != nil {
+		return err
+	}
+
+	ch := reflect.ValueOf(channel)
+	t := s.types[table]
+
+	go func() {
+		defer ch.Close()
+
+		col.ForEachDoc(func(docID int, data []byte) bool {
+			obj := reflect.New(t)
+
+			if err := json.Unmarshal(data, obj.Interface()); err != nil {
+				return true
+			}
+
+			ch.Send(obj.Elem())
+			return true
+		})
+	}()
+
+	return nil
+}
+
+// GetMany performs a Get request for every ID in the ID list and returns a slice of objects.
+func (s *Storage) GetMany(table string, idList []string) (interface{}, error) {
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	ptrType := reflect.SliceOf(reflect.PtrTo(t))
+	pointers := reflect.MakeSlice(ptrType, 0, len(idList))
+
+	for _, id := range idList {
+		obj, err := s.Get(table, id)
+
+		if err != nil {
+			// Mirrors the Aerospike back-end, whose BatchGetObjects leaves a
+			// missing key's destination object zero-valued rather than nil.
+			pointers = reflect.Append(pointers, reflect.New(t))
+			continue
+		}
+
+		pointers = reflect.Append(pointers, reflect.ValueOf(obj))
+	}
+
+	return pointers.Interface(), nil
+}
+
+// DeleteTable deletes all content from the given table. The collection is
+// dropped and recreated from scratch, so its indexes (including the idField
+// index RegisterType installs) have to be rebuilt afterwards.
+func (s *Storage) DeleteTable(table string) error {
+	if err := s.db.Drop(table); err != nil {
+		return err
+	}
+
+	if err := s.db.Create(table); err != nil {
+		return err
+	}
+
+	s.ensureIDIndex(table)
+	return nil
+}
+
+// Query runs a query against table using tiedot's index evaluator, and
+// returns the matching objects unmarshalled into the registered type.
+func (s *Storage) Query(table string, filter storage.Filter) (interface{}, error) {
+	t, exists := s.types[table]
+
+	if !exists {
+		return nil, errors.New("Data type has not been defined for table " + table)
+	}
+
+	col, err := s.col(table)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// tiedot only evaluates queries over indexed paths, so index filter.Bin
+	// on first use; an "already indexed" error is expected and ignored.
+	col.Index([]string{filter.Bin})
+
+	query := map[string]interface{}{"in": []interface{}{filter.Bin}}
+
+	if filter.Range {
+		// tiedot's range evaluator expects the float64 it would normally get
+		// from unmarshalling a JSON query, not the int64 Filter stores them
+		// as, and errors out on anything else.
+		query["int-from"] = float64(filter.Begin)
+		query["int-to"] = float64(filter.End)
+	} else {
+		query["eq"] = filter.Value
+	}
+
+	matched := make(map[int]struct{})
+
+	if err := db.EvalQuery(query, col, &matched); err != nil {
+		return nil, err
+	}
+
+	results := reflect.MakeSlice(reflect.SliceOf(reflect.PtrTo(t)), 0, len(matched))
+
+	for docID := range matched {
+		doc, err := col.Read(docID)
+
+		if err != nil {
+			continue
+		}
+
+		obj := reflect.New(t)
+
+		if err := decodeDoc(doc, obj.Interface()); err != nil {
+			return nil, err
+		}
+
+		results = reflect.Append(results, obj)
+	}
+
+	return results.Interface(), nil
+}
+
+// QueryStream runs the same index lookup as Query, but writes each match to
+// channel as its document is read back instead of collecting a slice.
+func (s *Storage) QueryStream(table string, filter storage.Filter, channel interface{}) error {
+	t, exists := s.types[table]
+
+	if !exists {
+		return errors.New("Data type has not been defined for table " + table)
+	}
+
+	col, err := s.col(table)
+
+	if err != nil {
+		return err
+	}
+
+	// Same on-first-use indexing of filter.Bin as Query.
+	col.Index([]string{filter.Bin})
+
+	query := map[string]interface{}{"in": []interface{}{filter.Bin}}
+
+	if filter.Range {
+		// tiedot's range evaluator expects the float64 it would normally get
+		// from unmarshalling a JSON query, not the int64 Filter stores them
+		// as, and errors out on anything else.
+		query["int-from"] = float64(filter.Begin)
+		query["int-to"] = float64(filter.End)
+	} else {
+		query["eq"] = filter.Value
+	}
+
+	matched := make(map[int]struct{})
+
+	if err := db.EvalQuery(query, col, &matched); err != nil {
+		return err
+	}
+
+	ch := reflect.ValueOf(channel)
+
+	go func() {
+		defer ch.Close()
+
+		for docID := range matched {
+			doc, err := col.Read(docID)
+
+			if err != nil {
+				continue
+			}
+
+			obj := reflect.New(t)
+
+			if err := decodeDoc(doc, obj.Interface()); err != nil {
+				continue
+			}
+
+			ch.Send(obj.Elem())
+		}
+	}()
+
+	return nil
+}
+
+// Type returns the type of the table.
+func (s *Storage) Type(table string) reflect.Type {
+	return s.types[table]
+}
+
+// Types returns the types of all tables as a map.
+func (s *Storage) Types() map[string]reflect.Type {
+	return s.types
+}
+
+func encodeDoc(obj interface{}) (map[string]interface{}, error) {
+	data, err := json.Marshal(obj)
+
+	if err != nil {
+		return nil, err
+	}
+
+	doc := make(map[string]interface{})
+	err = json.Unmarshal(data, &doc)
+	return doc, err
+}
+
+func decodeDoc(doc map[string]interface{}, obj interface{}) error {
+	data, err := json.Marshal(doc)
+
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, obj)
+}
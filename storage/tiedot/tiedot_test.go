@@ -0,0 +1,51 @@
+package tiedot
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/frozenprojects/aerospike/storage"
+)
+
+type widget struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Price int64  `json:"price"`
+}
+
+func newStorage(t *testing.T) *Storage {
+	s, err := New(t.TempDir())
+	if err != nil {
+		t.Fatalf("New returned error: %v", err)
+	}
+
+	s.RegisterType("widget", reflect.TypeOf(widget{}))
+	return s
+}
+
+func TestQueryRange(t *testing.T) {
+	s := newStorage(t)
+
+	for _, w := range []*widget{
+		{ID: "w1", Name: "sprocket", Price: 100},
+		{ID: "w2", Name: "cog", Price: 250},
+		{ID: "w3", Name: "sprocket", Price: 400},
+	} {
+		if err := s.Set("widget", w.ID, w); err != nil {
+			t.Fatalf("Set returned error: %v", err)
+		}
+	}
+
+	results, err := s.Query("widget", storage.NewRangeFilter("price", 200, 400))
+	if err != nil {
+		t.Fatalf("Query returned error: %v", err)
+	}
+
+	widgets, ok := results.([]*widget)
+	if !ok {
+		t.Fatalf("Query returned %T, want []*widget", results)
+	}
+	if got := len(widgets); got != 2 {
+		t.Fatalf("range Query returned %d results, want 2", got)
+	}
+}